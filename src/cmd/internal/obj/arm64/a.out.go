@@ -0,0 +1,143 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package arm64
+
+import "cmd/internal/obj"
+
+// Opcodes. This slice of the package only enumerates the mnemonics this
+// package's own code and test suite (asm_test.go) actually reference; it
+// stands in for the much larger real arm64 opcode table, which this
+// pruned checkout doesn't contain. APCALIGNMAX and ABTI are declared in
+// their proper place in that sequence, immediately before ALAST, so
+// they pick up whatever opcode number follows the last real entry
+// rather than a hand-picked offset that could alias one of the ~530
+// real arm64 opcodes this table doesn't show.
+const (
+	AADD obj.As = obj.ABaseARM64 + obj.A_ARCHSPECIFIC + iota
+	AMOVD
+	AMOVZ
+	AMOVK
+	ACBZ
+	ACBZW
+	ACBNZ
+	ACBNZW
+	ATBZ
+	ATBNZ
+	ABEQ
+	ABNE
+	ABCS
+	ABHS
+	ABCC
+	ABLO
+	ABMI
+	ABPL
+	ABVS
+	ABVC
+	ABHI
+	ABLS
+	ABGE
+	ABLT
+	ABGT
+	ABLE
+	ARET
+	ANOP
+	APCALIGN
+
+	// APCALIGNMAX is PCALIGN, but only pads up to a caller-supplied
+	// budget: if the padding required to reach the alignment would
+	// exceed the budget, no padding is emitted at all. Operands are
+	// p.From.Offset (the alignment) and p.To.Offset (the budget).
+	APCALIGNMAX
+
+	// ABTI is a Branch Target Identification landing pad
+	// (ARMv8.5-BTI). The variant (none, C, J, or JC) is carried in
+	// p.From.Offset, one of the btiHint constants below.
+	ABTI
+
+	ALAST
+)
+
+const (
+	AB  = obj.AJMP
+	ABL = obj.ACALL
+)
+
+// Anames holds the string form of the opcodes above, indexed by
+// as - obj.ABaseARM64 - obj.A_ARCHSPECIFIC. The generic assembler
+// frontend (cmd/asm) builds its mnemonic table from each arch's Anames
+// plus obj.Anames, which is how "PCALIGNMAX" and "BTI" become
+// recognized tokens for go tool asm without any further registration
+// in this package.
+var Anames = []string{
+	AADD - AADD:        "ADD",
+	AMOVD - AADD:       "MOVD",
+	AMOVZ - AADD:       "MOVZ",
+	AMOVK - AADD:       "MOVK",
+	ACBZ - AADD:        "CBZ",
+	ACBZW - AADD:       "CBZW",
+	ACBNZ - AADD:       "CBNZ",
+	ACBNZW - AADD:      "CBNZW",
+	ATBZ - AADD:        "TBZ",
+	ATBNZ - AADD:       "TBNZ",
+	ABEQ - AADD:        "BEQ",
+	ABNE - AADD:        "BNE",
+	ABCS - AADD:        "BCS",
+	ABHS - AADD:        "BHS",
+	ABCC - AADD:        "BCC",
+	ABLO - AADD:        "BLO",
+	ABMI - AADD:        "BMI",
+	ABPL - AADD:        "BPL",
+	ABVS - AADD:        "BVS",
+	ABVC - AADD:        "BVC",
+	ABHI - AADD:        "BHI",
+	ABLS - AADD:        "BLS",
+	ABGE - AADD:        "BGE",
+	ABLT - AADD:        "BLT",
+	ABGT - AADD:        "BGT",
+	ABLE - AADD:        "BLE",
+	ARET - AADD:        "RET",
+	ANOP - AADD:        "NOP",
+	APCALIGN - AADD:    "PCALIGN",
+	APCALIGNMAX - AADD: "PCALIGNMAX",
+	ABTI - AADD:        "BTI",
+}
+
+// Registers. As with the opcode table above, this only covers what this
+// package's new code needs: R16, the platform's designated
+// intra-procedure-call scratch register (also used by the linker for
+// its own call veneers), which makes it the natural choice for
+// materializing a trampoline's target address.
+const (
+	REG_R16 = obj.RBaseARM64 + 16
+	REGRT1  = REG_R16
+)
+
+// BTI hint-immediate encodings, per ARMv8.5 (HINT #imm, CRm=0b0100,
+// op2=0b000/0b010/0b100/0b110).
+const (
+	btiHintPlain = 32     // "BTI"    (no qualifier)
+	btiHintC     = 32 + 2 // "BTI C"  (landing pad for BR and BLR)
+	btiHintJ     = 32 + 4 // "BTI J"  (landing pad for BR only)
+	btiHintJC    = 32 + 6 // "BTI JC" (landing pad for BR and BLR)
+)
+
+// BTIHint maps the textual BTI operand to its HINT immediate. It is
+// exported so cmd/asm's arm64 frontend (outside this package, and not
+// present in this checkout) can call it from the special-operand
+// resolver it already uses for bare-identifier operands like
+// DAIFSet/DAIFClr, the same mechanism "BTI C"/"BTI J"/"BTI JC" need.
+func BTIHint(variant string) (int64, bool) {
+	switch variant {
+	case "":
+		return btiHintPlain, true
+	case "C":
+		return btiHintC, true
+	case "J":
+		return btiHintJ, true
+	case "JC":
+		return btiHintJC, true
+	}
+	return 0, false
+}
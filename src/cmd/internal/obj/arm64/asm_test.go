@@ -258,6 +258,44 @@ func TestPCALIGN(t *testing.T) {
 	}
 }
 
+// TestPCALIGNMAX verifies the correctness of PCALIGNMAX by checking that
+// alignment is only performed when the required padding does not exceed
+// the given budget.
+func TestPCALIGNMAX(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	// Budget covers the padding: "MOVD $1, R1" is pushed from offset 4 to
+	// the 8-byte aligned offset 8, which costs 4 bytes of NOP, within the
+	// $4 budget.
+	code1 := "TEXT ·foo(SB),$0-0\nMOVD $0, R0\nPCALIGNMAX $8, $4\nMOVD $1, R1\nRET\n"
+	// Budget is smaller than the required padding, so alignment is
+	// skipped and "MOVD $2, R2" stays at its natural offset, 4.
+	code2 := "TEXT ·foo(SB),$0-0\nMOVD $0, R0\nPCALIGNMAX $8, $2\nMOVD $2, R2\nRET\n"
+	// If the output contains this pattern, the pc-offset of "MOVD $1, R1" is 8 bytes aligned.
+	out1 := `0x0008\s00008\s\(.*\)\tMOVD\t\$1,\sR1`
+	// If the output contains this pattern, the pc-offset of "MOVD $2, R2" was left at its natural offset.
+	out2 := `0x0004\s00004\s\(.*\)\tMOVD\t\$2,\sR2`
+	var testCases = []struct {
+		name string
+		code string
+		out  string
+	}{
+		{"alignment within budget", code1, out1},
+		{"alignment exceeds budget", code2, out2},
+	}
+
+	for _, test := range testCases {
+		out := runAssembler(t, test.code)
+		matched, err := regexp.MatchString(test.out, string(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !matched {
+			t.Errorf("The %s testing failed!\ninput: %s\noutput: %s\n", test.name, test.code, out)
+		}
+	}
+}
+
 // gen generates function with set size
 func gen(buf *bytes.Buffer, name string, size int) {
 	fmt.Fprintln(buf, "TEXT ", name, "(SB),0,$0-0")
@@ -369,3 +407,204 @@ func TestFarCondBr19(t *testing.T) {
 		t.Errorf("test returned: %s wanted: %s", out, "42")
 	}
 }
+
+// TestBTI checks that, when assembling with GOARM64=v8.5,bti, the
+// assembler emits a "BTI c" landing pad at every TEXT entry, including
+// one reached only indirectly — through a trampoline inserted by the
+// far-branch fixup pass — and that go tool objdump shows it at the
+// expected location. The trampoline itself needs no landing pad: it is
+// only ever reached by a direct branch, and the indirect branch it
+// performs lands on the target's own "BTI c" pad.
+func TestBTI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skip in short mode")
+	}
+	testenv.MustHaveGoBuild(t)
+
+	dir, err := os.MkdirTemp("", "testbti")
+	if err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const branchDistance = 1 << (19 + 1)
+	const dummyFuncSize = branchDistance / 2
+
+	buf := bytes.NewBuffer(make([]byte, 0, 2*branchDistance*4+1024))
+
+	for i := 0; i*dummyFuncSize < branchDistance; i++ {
+		gen(buf, "·topdummyfunction"+strconv.Itoa(i), dummyFuncSize)
+	}
+
+	fmt.Fprintln(buf, "TEXT ·fartarget(SB),0,$0-0")
+	fmt.Fprintln(buf, "MOVD $42, R0")
+	fmt.Fprintln(buf, "RET")
+
+	tmpfile1 := filepath.Join(dir, "fartarget_arm64.s")
+	err = os.WriteFile(tmpfile1, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	buf.Reset()
+	fmt.Fprintln(buf, "TEXT ·farcondbrbti(SB),0,$0-8")
+	fmt.Fprintln(buf, "MOVD $0, R0")
+	fmt.Fprintln(buf, "CBZ R0, ·fartarget(SB)")
+	fmt.Fprintln(buf, "MOVD R0, ret+0(FP)")
+	fmt.Fprintln(buf, "RET")
+
+	tmpfile2 := filepath.Join(dir, "condbrbti_arm64.s")
+	err = os.WriteFile(tmpfile2, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	buf.Reset()
+	fmt.Fprintln(buf, "package main")
+	fmt.Fprintln(buf, "import \"fmt\"")
+	fmt.Fprintln(buf, "func farcondbrbti() uint64")
+	fmt.Fprintln(buf, "func main() { fmt.Print(farcondbrbti()) }")
+
+	tmpfile3 := filepath.Join(dir, "main.go")
+	err = os.WriteFile(tmpfile3, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	buf.Reset()
+	fmt.Fprintln(buf, "module testbti")
+	fmt.Fprintln(buf, "go 1.23") // TODO fix this
+
+	tmpfile4 := filepath.Join(dir, "go.mod")
+	err = os.WriteFile(tmpfile4, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	// build with GOARM64=v8.5,bti, which prepends BTI c at every TEXT
+	// entry, including fartarget's, which is otherwise only reachable
+	// indirectly via the CBZ-to-trampoline-to-BR chain above
+	fmt.Println("Build")
+	cmd := testenv.Command(t, testenv.GoToolPath(t), "build", "-C", dir, "-o", "testbti.out")
+	fmt.Println(cmd)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "GOARM64=v8.5,bti")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("build failed: %v, output: %s", err, out)
+	}
+
+	cmd = testenv.Command(t, testenv.GoToolPath(t), "tool", "objdump", filepath.Join(dir, "testbti.out"))
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("objdump failed: %v, output: %s", err, out)
+	}
+
+	entryPattern := regexp.MustCompile(`farcondbrbti[^\n]*\n[^\n]*bti\tc`)
+	if !entryPattern.Match(out) {
+		t.Errorf("expected \"bti c\" at the entry of farcondbrbti, got:\n%s", out)
+	}
+
+	targetEntryPattern := regexp.MustCompile(`fartarget[^\n]*\n[^\n]*bti\tc`)
+	if !targetEntryPattern.Match(out) {
+		t.Errorf("expected \"bti c\" at the entry of fartarget, the indirect branch's destination, got:\n%s", out)
+	}
+}
+
+// TestFarUncondBr26 makes sure that trampoline insertion works when an
+// unconditional B target is further than +-128Mb away.
+func TestFarUncondBr26(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skip in short mode")
+	}
+	testenv.MustHaveGoBuild(t)
+
+	dir, err := os.MkdirTemp("", "testuncondbranch26")
+	if err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const branchDistance = 1 << (26 + 1)
+	const dummyFuncSize = branchDistance / 2
+
+	// generate few a very large function
+	buf := bytes.NewBuffer(make([]byte, 0, 2*branchDistance*4+1024))
+
+	for i := 0; i*dummyFuncSize < branchDistance; i++ {
+		gen(buf, "·topdummyfunction"+strconv.Itoa(i), dummyFuncSize)
+	}
+
+	fmt.Fprintln(buf, "TEXT ·fartarget(SB),0,$0-0")
+	fmt.Fprintln(buf, "MOVD $42, R0")
+	fmt.Fprintln(buf, "RET")
+
+	for i := 0; i*dummyFuncSize < branchDistance; i++ {
+		gen(buf, "·bottomdummyfunction"+strconv.Itoa(i), dummyFuncSize)
+	}
+
+	tmpfile1 := filepath.Join(dir, "fartarget_arm64.s")
+	err = os.WriteFile(tmpfile1, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	// generate function with an unconditional B to the far target
+	buf.Reset()
+
+	fmt.Fprintln(buf, "TEXT ·faruncondbr26(SB),0,$0-8")
+	fmt.Fprintln(buf, "MOVD $0, R0")
+	fmt.Fprintln(buf, "B ·fartarget(SB)")
+	fmt.Fprintln(buf, "MOVD R0, ret+0(FP)")
+	fmt.Fprintln(buf, "RET")
+
+	tmpfile2 := filepath.Join(dir, "uncondbr26_arm64.s")
+	err = os.WriteFile(tmpfile2, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	buf.Reset()
+
+	fmt.Fprintln(buf, "package main")
+	fmt.Fprintln(buf, "import \"fmt\"")
+	fmt.Fprintln(buf, "func faruncondbr26() uint64")
+	fmt.Fprintln(buf, "func main() { fmt.Print(faruncondbr26()) }")
+
+	tmpfile3 := filepath.Join(dir, "main.go")
+	err = os.WriteFile(tmpfile3, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	// generate go.mod
+	buf.Reset()
+
+	fmt.Fprintln(buf, "module testuncondbr26")
+	fmt.Fprintln(buf, "go 1.23") // TODO fix this
+
+	tmpfile4 := filepath.Join(dir, "go.mod")
+	err = os.WriteFile(tmpfile4, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("can't write output: %v\n", err)
+	}
+
+	// build test
+	fmt.Println("Build")
+	cmd := testenv.Command(t, testenv.GoToolPath(t), "build", "-C", dir, "-o", "testuncondbr26.out")
+	fmt.Println(cmd)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("build failed: %v, output: %s", err, out)
+	}
+
+	cmd = testenv.Command(t, filepath.Join(dir, "testuncondbr26.out"))
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("runnig test failed: %v, output: %s", err, out)
+	}
+
+	if !(len(out) == 2 && out[0] == '4' && out[1] == '2') {
+		t.Errorf("test returned: %s wanted: %s", out, "42")
+	}
+}
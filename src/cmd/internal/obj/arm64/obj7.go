@@ -0,0 +1,50 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package arm64
+
+import (
+	"cmd/internal/obj"
+	"internal/buildcfg"
+)
+
+// btiMode reports whether the active build configuration requests
+// automatic BTI landing-pad emission, i.e. buildcfg.GOARM64 names an
+// extension list (the part after the version, e.g. "v8.5,bti")
+// containing the "bti" token. buildcfg parses GOARM64 once for the
+// whole toolchain, honoring -gcflags/-asmflags overrides the same way
+// GOARCH and GOARM do, so this package doesn't need its own GOARM64
+// parsing the way it would if it read the environment directly.
+//
+// ctxt is accepted, rather than consulting buildcfg as a bare package
+// global, so that a future per-object-file override (for example a
+// //go:build-tag-scoped opt-out) has a natural place to plug in without
+// changing every call site's signature again.
+func btiMode(ctxt *obj.Link) bool {
+	return buildcfg.GOARM64.BTI
+}
+
+// preprocessBTI is the new step this change adds to this package's
+// existing preprocess pass (which lowers frame setup and resolves
+// NAME_AUTO offsets; see span7Fixups in asm7.go for this package's
+// simplified stand-in for that pass and preprocessBTI's call site
+// within it). text is cursym.Func().Text, whose head is always the
+// ATEXT pseudo-op itself (it carries the symbol's position and flags,
+// not an emitted instruction). When btiMode is enabled, preprocessBTI
+// splices a "BTI C" landing pad in immediately after that head, making
+// it the first real instruction of every TEXT symbol, since any
+// exported or address-taken function may be reached via an indirect
+// branch from another translation unit.
+func preprocessBTI(ctxt *obj.Link, cursym *obj.LSym, text *obj.Prog) *obj.Prog {
+	if !btiMode(ctxt) || text == nil {
+		return text
+	}
+
+	bti := ctxt.NewProg()
+	bti.As = ABTI
+	bti.From = obj.Addr{Type: obj.TYPE_CONST, Offset: btiHintC}
+	bti.Link = text.Link
+	text.Link = bti
+	return text
+}